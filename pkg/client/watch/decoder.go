@@ -26,16 +26,25 @@ import (
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
 )
 
+// frameDecoder decodes one JSON-encoded value at a time from a stream. It's
+// implemented both by *json.Decoder (bare, newline-agnostic JSON stream)
+// and by lengthPrefixedDecoder (for transports that don't preserve message
+// boundaries).
+type frameDecoder interface {
+	Decode(v interface{}) error
+}
+
 // APIEventDecoder implements the watch.Decoder interface for io.ReadClosers that
 // have contents which consist of a series of api.WatchEvent objects encoded via JSON.
 // It will decode any object which is registered to convert to api.WatchEvent via
 // api.Scheme
 type APIEventDecoder struct {
 	stream  io.ReadCloser
-	decoder *json.Decoder
+	decoder frameDecoder
 }
 
-// NewAPIEventDecoder creates an APIEventDecoder for the given stream.
+// NewAPIEventDecoder creates an APIEventDecoder for the given stream, which
+// must contain a bare, back-to-back stream of JSON-encoded api.WatchEvents.
 func NewAPIEventDecoder(stream io.ReadCloser) *APIEventDecoder {
 	return &APIEventDecoder{
 		stream:  stream,
@@ -43,6 +52,17 @@ func NewAPIEventDecoder(stream io.ReadCloser) *APIEventDecoder {
 	}
 }
 
+// NewAPIEventDecoderFramed creates an APIEventDecoder for a stream where
+// each api.WatchEvent is prefixed with its length as a 4-byte big-endian
+// integer, for use with intermediaries that don't otherwise preserve JSON
+// message boundaries.
+func NewAPIEventDecoderFramed(stream io.ReadCloser) *APIEventDecoder {
+	return &APIEventDecoder{
+		stream:  stream,
+		decoder: newLengthPrefixedDecoder(stream),
+	}
+}
+
 // Decode blocks until it can return the next object in the stream. Returns an error
 // if the stream is closed or an object can't be decoded.
 func (d *APIEventDecoder) Decode() (action watch.EventType, object runtime.Object, err error) {
@@ -0,0 +1,148 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
+)
+
+func TestLengthPrefixedDecoderTruncatedObject(t *testing.T) {
+	payload := []byte(`{"hello":"world"}`)
+	var lengthBuf [4]byte
+	binary.BigEndian.PutUint32(lengthBuf[:], uint32(len(payload)))
+
+	var buf bytes.Buffer
+	buf.Write(lengthBuf[:])
+	buf.Write(payload[:len(payload)-5]) // cut the frame short mid-object
+
+	d := newLengthPrefixedDecoder(&buf)
+	var got map[string]interface{}
+	err := d.Decode(&got)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF from a truncated frame, got %v", err)
+	}
+}
+
+// fakeInnerDecoder is a hand-rolled watch.Decoder for exercising
+// ResumableDecoder without needing the api package's JSON wire format.
+type fakeInnerDecoder struct {
+	events []fakeEvent
+	pos    int
+	closed bool
+}
+
+type fakeEvent struct {
+	action watch.EventType
+	object runtime.Object
+	err    error
+}
+
+func (d *fakeInnerDecoder) Decode() (watch.EventType, runtime.Object, error) {
+	if d.pos >= len(d.events) {
+		return "", nil, io.EOF
+	}
+	e := d.events[d.pos]
+	d.pos++
+	return e.action, e.object, e.err
+}
+
+func (d *fakeInnerDecoder) Close() {
+	d.closed = true
+}
+
+type fakeVersionedObject struct {
+	resourceVersion string
+}
+
+func (o *fakeVersionedObject) IsAnAPIObject() {}
+
+func (o *fakeVersionedObject) GetResourceVersion() string {
+	return o.resourceVersion
+}
+
+func TestResumableDecoderReconnectsOnTruncation(t *testing.T) {
+	first := &fakeInnerDecoder{events: []fakeEvent{
+		{action: watch.Added, object: &fakeVersionedObject{resourceVersion: "5"}},
+		{err: io.ErrUnexpectedEOF},
+	}}
+	second := &fakeInnerDecoder{events: []fakeEvent{
+		{action: watch.Modified, object: &fakeVersionedObject{resourceVersion: "6"}},
+	}}
+
+	decoders := []*fakeInnerDecoder{first, second}
+	var dialed []string
+	dial := func(sinceResourceVersion string) (io.ReadCloser, error) {
+		dialed = append(dialed, sinceResourceVersion)
+		return ioutil.NopCloser(&bytes.Buffer{}), nil
+	}
+	makeDecoder := func(io.ReadCloser) watch.Decoder {
+		d := decoders[0]
+		decoders = decoders[1:]
+		return d
+	}
+
+	rd := NewResumableDecoder(ioutil.NopCloser(&bytes.Buffer{}), makeDecoder, dial)
+
+	action, object, err := rd.Decode()
+	if err != nil || action != watch.Added {
+		t.Fatalf("unexpected first decode: action=%v object=%v err=%v", action, object, err)
+	}
+
+	action, object, err = rd.Decode()
+	if err != nil {
+		t.Fatalf("expected the truncation to be papered over, got err=%v", err)
+	}
+	if action != watch.Modified {
+		t.Fatalf("expected to resume decoding from the reconnected stream, got action=%v", action)
+	}
+	if len(dialed) != 1 || dialed[0] != "5" {
+		t.Fatalf("expected reconnect to resume from resourceVersion 5, dialed=%v", dialed)
+	}
+	if !first.closed {
+		t.Errorf("expected the broken stream's decoder to be closed before reconnecting")
+	}
+}
+
+func TestResumableDecoderSurfacesGoneAs410(t *testing.T) {
+	inner := &fakeInnerDecoder{events: []fakeEvent{
+		{err: io.ErrUnexpectedEOF},
+	}}
+	dial := func(sinceResourceVersion string) (io.ReadCloser, error) {
+		return nil, ErrGone
+	}
+	makeDecoder := func(io.ReadCloser) watch.Decoder { return inner }
+
+	rd := NewResumableDecoder(ioutil.NopCloser(&bytes.Buffer{}), makeDecoder, dial)
+
+	action, object, err := rd.Decode()
+	if err != nil {
+		t.Fatalf("expected a synthetic event rather than an error, got %v", err)
+	}
+	if action != watch.Error {
+		t.Fatalf("expected a watch.Error event, got %v", action)
+	}
+	if _, ok := object.(*GoneError); !ok {
+		t.Fatalf("expected a *GoneError object, got %T", object)
+	}
+}
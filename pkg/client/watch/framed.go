@@ -0,0 +1,49 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watch
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+)
+
+// lengthPrefixedDecoder reads a stream of JSON values each prefixed by
+// their length as a 4-byte big-endian integer. Unlike a bare *json.Decoder,
+// it doesn't need the underlying reader to preserve message boundaries on
+// its own, at the cost of requiring the writer to frame its output the
+// same way.
+type lengthPrefixedDecoder struct {
+	r io.Reader
+}
+
+func newLengthPrefixedDecoder(r io.Reader) *lengthPrefixedDecoder {
+	return &lengthPrefixedDecoder{r: r}
+}
+
+func (d *lengthPrefixedDecoder) Decode(v interface{}) error {
+	var lengthBuf [4]byte
+	if _, err := io.ReadFull(d.r, lengthBuf[:]); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(lengthBuf[:])
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(d.r, payload); err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watch
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
+)
+
+// ErrGone should be returned by a DialFunc when the server reports that the
+// requested resource version is no longer available (HTTP 410 Gone).
+// ResumableDecoder reports it as a synthetic watch.Error event rather than
+// an error, since the caller has to relist.
+var ErrGone = errors.New("watch: resource version no longer available (410 Gone)")
+
+// DialFunc reopens a watch stream, resuming from sinceResourceVersion. An
+// empty sinceResourceVersion means "start from the beginning". It should
+// return ErrGone if the server responds 410 Gone.
+type DialFunc func(sinceResourceVersion string) (io.ReadCloser, error)
+
+// versionedObject is implemented by decoded objects that expose their
+// resourceVersion (api.JSONBase does), so ResumableDecoder knows where to
+// resume from after a reconnect.
+type versionedObject interface {
+	GetResourceVersion() string
+}
+
+// GoneError is the runtime.Object carried by the synthetic watch.Error
+// event ResumableDecoder emits when DialFunc reports ErrGone.
+type GoneError struct {
+	api.JSONBase
+	Message string
+}
+
+// IsAnAPIObject marks GoneError as a runtime.Object.
+func (*GoneError) IsAnAPIObject() {}
+
+// ResumableDecoder wraps a watch.Decoder so that a truncated stream or
+// network error doesn't end the watch: it transparently reconnects via
+// dial, resuming from the resourceVersion of the last object it
+// successfully decoded. If the server reports the watch point is gone, it
+// surfaces a synthetic watch.Error event so the caller knows to relist. Any
+// other failed dial, and any decode error that isn't a stream break, is
+// returned to the caller without a retry.
+type ResumableDecoder struct {
+	stream      io.ReadCloser
+	decoder     watch.Decoder
+	makeDecoder func(io.ReadCloser) watch.Decoder
+	dial        DialFunc
+
+	lastResourceVersion string
+}
+
+// NewResumableDecoder decodes stream via makeDecoder and wraps it with
+// automatic reconnect-and-resume. makeDecoder is called again on every
+// reconnect so the chosen framing (bare or length-prefixed) carries over.
+func NewResumableDecoder(stream io.ReadCloser, makeDecoder func(io.ReadCloser) watch.Decoder, dial DialFunc) *ResumableDecoder {
+	return &ResumableDecoder{
+		stream:      stream,
+		decoder:     makeDecoder(stream),
+		makeDecoder: makeDecoder,
+		dial:        dial,
+	}
+}
+
+// Decode blocks until it can return the next object in the stream,
+// reconnecting underneath each time the stream breaks, for as long as each
+// dial succeeds.
+func (d *ResumableDecoder) Decode() (watch.EventType, runtime.Object, error) {
+	for {
+		action, object, err := d.decoder.Decode()
+		if err == nil {
+			if versioned, ok := object.(versionedObject); ok {
+				d.lastResourceVersion = versioned.GetResourceVersion()
+			}
+			return action, object, nil
+		}
+		if !isResumable(err) {
+			return action, object, err
+		}
+
+		gone, dialErr := d.reconnect()
+		if gone {
+			return watch.Error, &GoneError{Message: dialErr.Error()}, nil
+		}
+		if dialErr != nil {
+			return action, object, dialErr
+		}
+		// Loop around and decode from the freshly-dialed stream.
+	}
+}
+
+// Close closes the underlying stream.
+func (d *ResumableDecoder) Close() {
+	d.decoder.Close()
+}
+
+func (d *ResumableDecoder) reconnect() (gone bool, err error) {
+	d.decoder.Close()
+
+	stream, err := d.dial(d.lastResourceVersion)
+	if err != nil {
+		return err == ErrGone, err
+	}
+	d.stream = stream
+	d.decoder = d.makeDecoder(stream)
+	return false, nil
+}
+
+// isResumable reports whether err is the kind of stream break
+// ResumableDecoder should paper over with a reconnect, rather than hand
+// back to the caller.
+func isResumable(err error) bool {
+	if err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return false
+}
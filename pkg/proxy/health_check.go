@@ -0,0 +1,101 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// HealthChecker decides whether a single endpoint is currently able to
+// serve traffic. Implementations are called from a background probe loop,
+// so IsHealthy should apply its own timeout rather than block indefinitely.
+type HealthChecker interface {
+	IsHealthy(endpoint string) bool
+}
+
+// tcpHealthChecker considers an endpoint healthy if a TCP connection to it
+// succeeds. It's the default for TCP services.
+type tcpHealthChecker struct {
+	timeout time.Duration
+}
+
+func (c tcpHealthChecker) IsHealthy(endpoint string) bool {
+	conn, err := net.DialTimeout("tcp", endpoint, c.timeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// udpHealthChecker considers a UDP endpoint healthy if it replies to a
+// probe payload within the timeout. It's the default for UDP services.
+type udpHealthChecker struct {
+	probe   []byte
+	timeout time.Duration
+}
+
+func (c udpHealthChecker) IsHealthy(endpoint string) bool {
+	conn, err := net.DialTimeout("udp", endpoint, c.timeout)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := conn.Write(c.probe); err != nil {
+		return false
+	}
+	var buf [1]byte
+	_, err = conn.Read(buf[0:])
+	return err == nil
+}
+
+// httpHealthChecker considers an endpoint healthy if an HTTP GET to path
+// returns 200 OK within the timeout. Services opt into this by setting
+// api.Endpoints.HealthCheckPath.
+type httpHealthChecker struct {
+	path    string
+	timeout time.Duration
+}
+
+func (c httpHealthChecker) IsHealthy(endpoint string) bool {
+	client := http.Client{Timeout: c.timeout}
+	resp, err := client.Get("http://" + endpoint + c.path)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// healthCheckerFor picks the HealthChecker implied by a service's endpoint
+// metadata: an explicit HealthCheckPath always wins, otherwise the choice
+// follows Protocol ("UDP" vs everything else, which is treated as TCP).
+func healthCheckerFor(endpoints api.Endpoints, timeout time.Duration) HealthChecker {
+	if endpoints.HealthCheckPath != "" {
+		return httpHealthChecker{path: endpoints.HealthCheckPath, timeout: timeout}
+	}
+	if endpoints.Protocol == "UDP" {
+		return udpHealthChecker{probe: []byte("\n"), timeout: timeout}
+	}
+	return tcpHealthChecker{timeout: timeout}
+}
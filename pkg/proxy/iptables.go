@@ -0,0 +1,236 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/golang/glog"
+)
+
+const natTable = "nat"
+
+// kubeServicesChain is the chain every service's dispatch rule lives in;
+// it is spliced into PREROUTING once, at Init time.
+const kubeServicesChain = "KUBE-SERVICES"
+
+// Iptables is the subset of the iptables command line that IptablesProxier
+// needs, abstracted so tests can supply a fake.
+type Iptables interface {
+	// EnsureChain creates chain in table if it doesn't already exist.
+	EnsureChain(table, chain string) error
+	// FlushChain removes all rules from chain, leaving the chain itself in
+	// place.
+	FlushChain(table, chain string) error
+	// DeleteChain removes chain from table. The chain must be empty and
+	// unreferenced.
+	DeleteChain(table, chain string) error
+	// EnsureRule appends args to chain if an identical rule isn't already
+	// present.
+	EnsureRule(table, chain string, args ...string) error
+	// DeleteRule removes the rule matching args from chain, if present.
+	DeleteRule(table, chain string, args ...string) error
+}
+
+// iptablesServiceInfo is what IptablesProxier remembers about a service
+// between syncs, so it can tell what changed.
+type iptablesServiceInfo struct {
+	port      int
+	protocol  string
+	chain     string
+	endpoints []string
+}
+
+// IptablesProxier is an alternative to the userspace Proxier: rather than
+// terminating connections itself, it programs iptables DNAT rules so the
+// kernel forwards packets straight to an endpoint. It shares the
+// LoadBalancer abstraction with the userspace Proxier purely as the source
+// of truth for each service's current endpoints.
+type IptablesProxier struct {
+	mu           sync.Mutex
+	loadBalancer LoadBalancer
+	iptables     Iptables
+	services     map[string]*iptablesServiceInfo
+}
+
+// NewIptablesProxier returns a new IptablesProxier. Init must be called
+// once before the first OnUpdate.
+func NewIptablesProxier(loadBalancer LoadBalancer, iptables Iptables) *IptablesProxier {
+	return &IptablesProxier{
+		loadBalancer: loadBalancer,
+		iptables:     iptables,
+		services:     map[string]*iptablesServiceInfo{},
+	}
+}
+
+// Init creates the chains and top-level dispatch rule that every service's
+// rules hang off of.
+func (proxier *IptablesProxier) Init() error {
+	if err := proxier.iptables.EnsureChain(natTable, kubeServicesChain); err != nil {
+		return err
+	}
+	return proxier.iptables.EnsureRule(natTable, "PREROUTING", "-m", "comment",
+		"--comment", "kubernetes service portals", "-j", kubeServicesChain)
+}
+
+// OnUpdate reconciles iptables with the given complete list of services.
+func (proxier *IptablesProxier) OnUpdate(services []api.Service) {
+	desired := map[string]api.Service{}
+	for _, service := range services {
+		desired[service.ID] = service
+	}
+
+	proxier.mu.Lock()
+	defer proxier.mu.Unlock()
+
+	for id, service := range desired {
+		if err := proxier.syncService(service); err != nil {
+			glog.Errorf("Failed to sync iptables rules for %s: %v", id, err)
+		}
+	}
+	for id := range proxier.services {
+		if _, exists := desired[id]; !exists {
+			if err := proxier.deleteService(id); err != nil {
+				glog.Errorf("Failed to remove iptables rules for %s: %v", id, err)
+			}
+		}
+	}
+}
+
+func (proxier *IptablesProxier) syncService(service api.Service) error {
+	serviceChain := serviceChainName(service.ID)
+	endpoints := proxier.loadBalancer.ListEndpoints(service.ID)
+
+	old, existed := proxier.services[service.ID]
+	if existed && (old.port != service.Port || !strings.EqualFold(old.protocol, service.Protocol)) {
+		if err := proxier.deletePortalRule(old); err != nil {
+			return err
+		}
+	}
+
+	if err := proxier.iptables.EnsureChain(natTable, serviceChain); err != nil {
+		return err
+	}
+	if err := proxier.iptables.FlushChain(natTable, serviceChain); err != nil {
+		return err
+	}
+	if existed {
+		for _, endpoint := range old.endpoints {
+			proxier.iptables.FlushChain(natTable, endpointChainName(service.ID, endpoint))
+			proxier.iptables.DeleteChain(natTable, endpointChainName(service.ID, endpoint))
+		}
+	}
+
+	n := len(endpoints)
+	for i, endpoint := range endpoints {
+		endpointChain := endpointChainName(service.ID, endpoint)
+		if err := proxier.iptables.EnsureChain(natTable, endpointChain); err != nil {
+			return err
+		}
+		if err := proxier.iptables.FlushChain(natTable, endpointChain); err != nil {
+			return err
+		}
+		if err := proxier.iptables.EnsureRule(natTable, endpointChain,
+			"-j", "DNAT", "--to-destination", endpoint); err != nil {
+			return err
+		}
+		// Rule i matches 1/(n-i) of the traffic that the rules before it
+		// left unmatched, so the probability rises as we go and, matched in
+		// order, every endpoint ends up with an equal 1/n chance of being
+		// picked.
+		args := []string{}
+		if i < n-1 {
+			probability := strconv.FormatFloat(1.0/float64(n-i), 'f', -1, 64)
+			args = append(args, "-m", "statistic", "--mode", "random", "--probability", probability)
+		}
+		args = append(args, "-j", endpointChain)
+		if err := proxier.iptables.EnsureRule(natTable, serviceChain, args...); err != nil {
+			return err
+		}
+	}
+
+	info := &iptablesServiceInfo{
+		port:      service.Port,
+		protocol:  service.Protocol,
+		chain:     serviceChain,
+		endpoints: endpoints,
+	}
+	if err := proxier.ensurePortalRule(info); err != nil {
+		return err
+	}
+	proxier.services[service.ID] = info
+	return nil
+}
+
+func (proxier *IptablesProxier) deleteService(id string) error {
+	info, exists := proxier.services[id]
+	if !exists {
+		return nil
+	}
+	if err := proxier.deletePortalRule(info); err != nil {
+		return err
+	}
+	if err := proxier.iptables.FlushChain(natTable, info.chain); err != nil {
+		return err
+	}
+	if err := proxier.iptables.DeleteChain(natTable, info.chain); err != nil {
+		return err
+	}
+	for _, endpoint := range info.endpoints {
+		proxier.iptables.FlushChain(natTable, endpointChainName(id, endpoint))
+		proxier.iptables.DeleteChain(natTable, endpointChainName(id, endpoint))
+	}
+	delete(proxier.services, id)
+	return nil
+}
+
+func (proxier *IptablesProxier) ensurePortalRule(info *iptablesServiceInfo) error {
+	return proxier.iptables.EnsureRule(natTable, kubeServicesChain, portalRuleArgs(info)...)
+}
+
+func (proxier *IptablesProxier) deletePortalRule(info *iptablesServiceInfo) error {
+	return proxier.iptables.DeleteRule(natTable, kubeServicesChain, portalRuleArgs(info)...)
+}
+
+func portalRuleArgs(info *iptablesServiceInfo) []string {
+	return []string{
+		"-p", strings.ToLower(info.protocol),
+		"--dport", strconv.Itoa(info.port),
+		"-j", info.chain,
+	}
+}
+
+func serviceChainName(serviceID string) string {
+	return "KUBE-SVC-" + hashForChain(serviceID)
+}
+
+func endpointChainName(serviceID, endpoint string) string {
+	return "KUBE-SEP-" + hashForChain(fmt.Sprintf("%s/%s", serviceID, endpoint))
+}
+
+// hashForChain turns an arbitrary string into a short, deterministic,
+// iptables-chain-name-safe token (iptables caps chain names at 28 chars).
+func hashForChain(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:])[:16])
+}
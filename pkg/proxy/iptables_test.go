@@ -0,0 +1,194 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// fakeIptables is an in-memory stand-in for the real iptables binary; it
+// records each chain's rules, in order, as the formatted args that would
+// have been passed to iptables.
+type fakeIptables struct {
+	chains map[string][]string // "table/chain" -> rules, each "arg arg arg"
+}
+
+func newFakeIptables() *fakeIptables {
+	return &fakeIptables{chains: map[string][]string{}}
+}
+
+func key(table, chain string) string { return table + "/" + chain }
+
+func ruleString(args []string) string { return strings.Join(args, " ") }
+
+func (f *fakeIptables) EnsureChain(table, chain string) error {
+	k := key(table, chain)
+	if _, exists := f.chains[k]; !exists {
+		f.chains[k] = []string{}
+	}
+	return nil
+}
+
+func (f *fakeIptables) FlushChain(table, chain string) error {
+	f.chains[key(table, chain)] = []string{}
+	return nil
+}
+
+func (f *fakeIptables) DeleteChain(table, chain string) error {
+	delete(f.chains, key(table, chain))
+	return nil
+}
+
+func (f *fakeIptables) EnsureRule(table, chain string, args ...string) error {
+	k := key(table, chain)
+	rule := ruleString(args)
+	for _, existing := range f.chains[k] {
+		if existing == rule {
+			return nil
+		}
+	}
+	f.chains[k] = append(f.chains[k], rule)
+	return nil
+}
+
+func (f *fakeIptables) DeleteRule(table, chain string, args ...string) error {
+	k := key(table, chain)
+	rule := ruleString(args)
+	rules := f.chains[k]
+	for i, existing := range rules {
+		if existing == rule {
+			f.chains[k] = append(rules[:i], rules[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func setupIptablesProxier(t *testing.T) (*IptablesProxier, *fakeIptables, *LoadBalancerRR) {
+	ipt := newFakeIptables()
+	lb := NewLoadBalancerRR()
+	p := NewIptablesProxier(lb, ipt)
+	if err := p.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p, ipt, lb
+}
+
+func TestIptablesProxyAddService(t *testing.T) {
+	p, ipt, lb := setupIptablesProxier(t)
+
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{"1.1.1.1:80", "2.2.2.2:80"}},
+	})
+	p.OnUpdate([]api.Service{
+		{JSONBase: api.JSONBase{ID: "echo"}, Port: 80, Protocol: "TCP"},
+	})
+
+	serviceChain := serviceChainName("echo")
+	portal := ipt.chains[key(natTable, kubeServicesChain)]
+	wantPortal := []string{"-p tcp --dport 80 -j " + serviceChain}
+	if !reflect.DeepEqual(portal, wantPortal) {
+		t.Errorf("KUBE-SERVICES rules = %v, want %v", portal, wantPortal)
+	}
+
+	svcRules := ipt.chains[key(natTable, serviceChain)]
+	if len(svcRules) != 2 {
+		t.Fatalf("expected 2 rules in %s, got %v", serviceChain, svcRules)
+	}
+	if !strings.Contains(svcRules[0], "--probability 0.5") {
+		t.Errorf("expected first endpoint rule to carry --probability 0.5, got %q", svcRules[0])
+	}
+	if strings.Contains(svcRules[1], "--probability") {
+		t.Errorf("expected last endpoint rule to carry no probability match, got %q", svcRules[1])
+	}
+
+	ep0Chain := endpointChainName("echo", "1.1.1.1:80")
+	if got := ipt.chains[key(natTable, ep0Chain)]; len(got) != 1 || !strings.Contains(got[0], "--to-destination 1.1.1.1:80") {
+		t.Errorf("unexpected DNAT rule for first endpoint: %v", got)
+	}
+}
+
+func TestIptablesProxyUpdateEndpoints(t *testing.T) {
+	p, ipt, lb := setupIptablesProxier(t)
+
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{"1.1.1.1:80"}},
+	})
+	p.OnUpdate([]api.Service{
+		{JSONBase: api.JSONBase{ID: "echo"}, Port: 80, Protocol: "TCP"},
+	})
+
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{"2.2.2.2:80"}},
+	})
+	p.OnUpdate([]api.Service{
+		{JSONBase: api.JSONBase{ID: "echo"}, Port: 80, Protocol: "TCP"},
+	})
+
+	oldChain := endpointChainName("echo", "1.1.1.1:80")
+	if _, exists := ipt.chains[key(natTable, oldChain)]; exists {
+		t.Errorf("expected stale endpoint chain %s to be removed", oldChain)
+	}
+	newChain := endpointChainName("echo", "2.2.2.2:80")
+	if _, exists := ipt.chains[key(natTable, newChain)]; !exists {
+		t.Errorf("expected endpoint chain %s to exist", newChain)
+	}
+}
+
+func TestIptablesProxyUpdatePort(t *testing.T) {
+	p, ipt, lb := setupIptablesProxier(t)
+
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{"1.1.1.1:80"}},
+	})
+	p.OnUpdate([]api.Service{
+		{JSONBase: api.JSONBase{ID: "echo"}, Port: 80, Protocol: "TCP"},
+	})
+	p.OnUpdate([]api.Service{
+		{JSONBase: api.JSONBase{ID: "echo"}, Port: 8080, Protocol: "TCP"},
+	})
+
+	serviceChain := serviceChainName("echo")
+	portal := ipt.chains[key(natTable, kubeServicesChain)]
+	want := []string{"-p tcp --dport 8080 -j " + serviceChain}
+	if !reflect.DeepEqual(portal, want) {
+		t.Errorf("KUBE-SERVICES rules after port change = %v, want %v", portal, want)
+	}
+}
+
+func TestIptablesProxyDeleteService(t *testing.T) {
+	p, ipt, lb := setupIptablesProxier(t)
+
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{"1.1.1.1:80"}},
+	})
+	p.OnUpdate([]api.Service{
+		{JSONBase: api.JSONBase{ID: "echo"}, Port: 80, Protocol: "TCP"},
+	})
+	p.OnUpdate([]api.Service{})
+
+	if portal := ipt.chains[key(natTable, kubeServicesChain)]; len(portal) != 0 {
+		t.Errorf("expected KUBE-SERVICES to be empty after delete, got %v", portal)
+	}
+	if _, exists := ipt.chains[key(natTable, serviceChainName("echo"))]; exists {
+		t.Errorf("expected service chain to be removed after delete")
+	}
+}
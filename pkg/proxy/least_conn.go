@@ -0,0 +1,128 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// ConnectionTracker is implemented by LoadBalancers that want to be told
+// when a proxied connection to one of their endpoints opens or closes, so
+// that they can factor active connection counts into endpoint selection.
+// tcpProxySocket type-asserts for this interface and calls it around the
+// lifetime of each proxied TCP connection; UDP sessions are not reported.
+type ConnectionTracker interface {
+	Connected(service, endpoint string)
+	Disconnected(service, endpoint string)
+}
+
+// LeastConnLoadBalancer is a LoadBalancer that always picks the endpoint
+// with the fewest currently active proxied connections. Ties are broken by
+// endpoint order, which keeps the choice deterministic for tests.
+type LeastConnLoadBalancer struct {
+	lock      sync.Mutex
+	endpoints map[string][]string
+	active    map[string]map[string]int
+}
+
+// NewLeastConnLoadBalancer returns a new LeastConnLoadBalancer.
+func NewLeastConnLoadBalancer() *LeastConnLoadBalancer {
+	return &LeastConnLoadBalancer{
+		endpoints: map[string][]string{},
+		active:    map[string]map[string]int{},
+	}
+}
+
+func (lb *LeastConnLoadBalancer) NextEndpoint(service string, srcAddr net.Addr) (string, error) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	endpoints := lb.endpoints[service]
+	if len(endpoints) == 0 {
+		return "", fmt.Errorf("no endpoints for %s", service)
+	}
+
+	counts := lb.active[service]
+	best := endpoints[0]
+	bestCount := counts[best]
+	for _, endpoint := range endpoints[1:] {
+		if counts[endpoint] < bestCount {
+			best = endpoint
+			bestCount = counts[endpoint]
+		}
+	}
+	return best, nil
+}
+
+// Connected records that a new connection to endpoint was established for
+// service. It should be called once a dial to the chosen endpoint succeeds.
+func (lb *LeastConnLoadBalancer) Connected(service, endpoint string) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	counts, exists := lb.active[service]
+	if !exists {
+		counts = map[string]int{}
+		lb.active[service] = counts
+	}
+	counts[endpoint]++
+}
+
+// Disconnected records that a connection to endpoint for service has
+// closed. It should be called exactly once per successful Connected call.
+func (lb *LeastConnLoadBalancer) Disconnected(service, endpoint string) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	counts, exists := lb.active[service]
+	if !exists {
+		return
+	}
+	if counts[endpoint] > 0 {
+		counts[endpoint]--
+	}
+}
+
+func (lb *LeastConnLoadBalancer) ListEndpoints(service string) []string {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	return append([]string{}, lb.endpoints[service]...)
+}
+
+func (lb *LeastConnLoadBalancer) OnUpdate(endpoints []api.Endpoints) {
+	registered := make(map[string]bool)
+
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	for _, svcEndpoints := range endpoints {
+		lb.endpoints[svcEndpoints.ID] = svcEndpoints.Endpoints
+		if _, exists := lb.active[svcEndpoints.ID]; !exists {
+			lb.active[svcEndpoints.ID] = map[string]int{}
+		}
+		registered[svcEndpoints.ID] = true
+	}
+
+	for service := range lb.endpoints {
+		if !registered[service] {
+			delete(lb.endpoints, service)
+			delete(lb.active, service)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// LoadBalancer picks an endpoint for a connection, given the service it is
+// destined for and the address it is arriving from. Implementations are
+// expected to be safe for concurrent use, since NextEndpoint is called once
+// per incoming connection from the Proxier's accept/receive loops.
+type LoadBalancer interface {
+	// NextEndpoint returns the endpoint ("host:port") that a new connection
+	// to service, arriving from srcAddr, should be forwarded to.
+	NextEndpoint(service string, srcAddr net.Addr) (string, error)
+
+	// OnUpdate notifies the LoadBalancer of the current complete list of
+	// endpoints for all services. Services that no longer appear are
+	// removed.
+	OnUpdate(endpoints []api.Endpoints)
+
+	// ListEndpoints returns the current endpoints known for service, in no
+	// particular order. Used by proxy implementations (e.g. the iptables
+	// Proxier) that need the whole set rather than one choice per call.
+	ListEndpoints(service string) []string
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+func mustResolveUDPAddr(t *testing.T, s string) net.Addr {
+	addr, err := net.ResolveUDPAddr("udp", s)
+	if err != nil {
+		t.Fatalf("error resolving %s: %v", s, err)
+	}
+	return addr
+}
+
+func TestLeastConnLoadBalancerPrefersIdleEndpoint(t *testing.T) {
+	lb := NewLeastConnLoadBalancer()
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{"1.1.1.1:80", "2.2.2.2:80"}},
+	})
+
+	lb.Connected("echo", "1.1.1.1:80")
+	lb.Connected("echo", "1.1.1.1:80")
+
+	endpoint, err := lb.NextEndpoint("echo", mustResolveUDPAddr(t, "10.0.0.1:1000"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if endpoint != "2.2.2.2:80" {
+		t.Errorf("expected the idle endpoint, got %s", endpoint)
+	}
+
+	lb.Disconnected("echo", "1.1.1.1:80")
+	lb.Disconnected("echo", "1.1.1.1:80")
+	lb.Connected("echo", "2.2.2.2:80")
+
+	endpoint, err = lb.NextEndpoint("echo", mustResolveUDPAddr(t, "10.0.0.1:1000"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if endpoint != "1.1.1.1:80" {
+		t.Errorf("expected the now-idle endpoint, got %s", endpoint)
+	}
+}
+
+func TestSourceHashLoadBalancerIsSticky(t *testing.T) {
+	lb := NewSourceHashLoadBalancer()
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{"1.1.1.1:80", "2.2.2.2:80", "3.3.3.3:80"}},
+	})
+
+	client := mustResolveUDPAddr(t, "10.0.0.1:12345")
+	first, err := lb.NextEndpoint("echo", client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		endpoint, err := lb.NextEndpoint("echo", client)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if endpoint != first {
+			t.Errorf("expected the same endpoint on every call, got %s then %s", first, endpoint)
+		}
+	}
+}
+
+func TestSourceHashLoadBalancerSpreadsClients(t *testing.T) {
+	lb := NewSourceHashLoadBalancer()
+	endpoints := []string{"1.1.1.1:80", "2.2.2.2:80", "3.3.3.3:80"}
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: endpoints},
+	})
+
+	counts := map[string]int{}
+	for i := 0; i < 300; i++ {
+		client := mustResolveUDPAddr(t, net.JoinHostPort(fmt.Sprintf("10.0.%d.%d", i/256, i%256), "1"))
+		endpoint, err := lb.NextEndpoint("echo", client)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		counts[endpoint]++
+	}
+	for _, endpoint := range endpoints {
+		if counts[endpoint] == 0 {
+			t.Errorf("endpoint %s never selected across 300 distinct clients", endpoint)
+		}
+	}
+}
+
+func TestWeightedRoundRobinLoadBalancerHonorsWeights(t *testing.T) {
+	lb := NewWeightedRoundRobinLoadBalancer()
+	lb.OnUpdate([]api.Endpoints{
+		{
+			JSONBase:  api.JSONBase{ID: "echo"},
+			Endpoints: []string{"1.1.1.1:80", "2.2.2.2:80"},
+			Weights:   map[string]int{"1.1.1.1:80": 3, "2.2.2.2:80": 1},
+		},
+	})
+
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		endpoint, err := lb.NextEndpoint("echo", mustResolveUDPAddr(t, "10.0.0.1:1000"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		counts[endpoint]++
+	}
+	if counts["1.1.1.1:80"] != 6 || counts["2.2.2.2:80"] != 2 {
+		t.Errorf("expected a 3:1 split over two cycles, got %v", counts)
+	}
+}
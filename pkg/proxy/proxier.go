@@ -0,0 +1,220 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package proxy implements a userspace TCP/UDP proxy that forwards
+// connections destined for a service to one of its endpoints, chosen by a
+// pluggable LoadBalancer.
+package proxy
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/golang/glog"
+)
+
+// Proxier is a TCP/UDP proxy for services, backed by a LoadBalancer.
+type Proxier struct {
+	loadBalancer LoadBalancer
+	mu           sync.Mutex // protects serviceMap
+	serviceMap   map[string]*serviceInfo
+	bindAddr     net.IP
+}
+
+type serviceInfo struct {
+	port        int
+	protocol    string
+	socket      proxySocket
+	timeout     time.Duration
+	maxSessions int
+	bindAddr    net.IP
+}
+
+// ServiceConfig holds per-service tunables for the proxy, set via
+// api.Service.Config. A zero value means "use the proxy defaults": no
+// idle timeout and no session limit.
+type ServiceConfig struct {
+	IdleTimeout time.Duration
+	MaxSessions int
+}
+
+// ProxierStats is a point-in-time snapshot of UDP session activity across
+// every service the Proxier is serving, returned by Proxier.Stats.
+type ProxierStats struct {
+	ActiveUDPSessions   int64
+	UDPPacketsForwarded int64
+	UDPTimeouts         int64
+}
+
+// statsProvider is implemented by proxySockets that can report UDP session
+// stats; tcpProxySocket does not implement it.
+type statsProvider interface {
+	snapshotStats() (active, forwarded, timeouts int64)
+}
+
+// NewProxier returns a new Proxier that forwards connections to endpoints
+// chosen by loadBalancer. bindAddr is the default interface services are exposed on
+// (v4 or v6); it may be overridden per-service via api.Service.BindAddress.
+func NewProxier(loadBalancer LoadBalancer, bindAddr net.IP) *Proxier {
+	return &Proxier{
+		loadBalancer: loadBalancer,
+		serviceMap:   map[string]*serviceInfo{},
+		bindAddr:     bindAddr,
+	}
+}
+
+// StopProxy stops the proxy for the named service, closing its listening
+// socket.
+func (proxier *Proxier) StopProxy(service string) error {
+	proxier.mu.Lock()
+	defer proxier.mu.Unlock()
+	return proxier.stopProxyInternal(service)
+}
+
+func (proxier *Proxier) stopProxyInternal(service string) error {
+	info, found := proxier.serviceMap[service]
+	if !found {
+		return nil
+	}
+	delete(proxier.serviceMap, service)
+	return info.socket.Close()
+}
+
+func (proxier *Proxier) getServiceInfo(service string) (*serviceInfo, bool) {
+	proxier.mu.Lock()
+	defer proxier.mu.Unlock()
+	info, ok := proxier.serviceMap[service]
+	return info, ok
+}
+
+func (proxier *Proxier) setServiceInfo(service string, info *serviceInfo) {
+	proxier.mu.Lock()
+	defer proxier.mu.Unlock()
+	proxier.serviceMap[service] = info
+}
+
+// addServiceOnUnusedPort starts proxying for service on an unused port of
+// the Proxier's default bind address, returning the port that was chosen.
+func (proxier *Proxier) addServiceOnUnusedPort(service, protocol string, timeout time.Duration) (string, error) {
+	return proxier.addServiceOnPort(service, proxier.bindAddr, protocol, 0, timeout, 0)
+}
+
+func (proxier *Proxier) addServiceOnPort(service string, bindAddr net.IP, protocol string, port int, timeout time.Duration, maxSessions int) (string, error) {
+	sock, err := newProxySocket(strings.ToLower(protocol), bindAddr, port, timeout, maxSessions)
+	if err != nil {
+		return "", err
+	}
+	_, portStr, err := net.SplitHostPort(sock.Addr().String())
+	if err != nil {
+		sock.Close()
+		return "", err
+	}
+	portNum, err := strconv.Atoi(portStr)
+	if err != nil {
+		sock.Close()
+		return "", err
+	}
+	proxier.setServiceInfo(service, &serviceInfo{
+		port:        portNum,
+		protocol:    protocol,
+		socket:      sock,
+		timeout:     timeout,
+		maxSessions: maxSessions,
+		bindAddr:    bindAddr,
+	})
+	go sock.ProxyLoop(service, proxier.loadBalancer)
+	return portStr, nil
+}
+
+// addService starts (or restarts, if the port/protocol/bind address/config
+// changed) proxying for service on bindAddr:port. A nil bindAddr falls back
+// to the Proxier's default.
+func (proxier *Proxier) addService(service string, bindAddr net.IP, port int, protocol string, timeout time.Duration, maxSessions int) error {
+	if bindAddr == nil {
+		bindAddr = proxier.bindAddr
+	}
+	if info, exists := proxier.getServiceInfo(service); exists {
+		if info.port == port && strings.EqualFold(info.protocol, protocol) && info.bindAddr.Equal(bindAddr) &&
+			info.timeout == timeout && info.maxSessions == maxSessions {
+			return nil
+		}
+		if err := proxier.StopProxy(service); err != nil {
+			return err
+		}
+	}
+	_, err := proxier.addServiceOnPort(service, bindAddr, protocol, port, timeout, maxSessions)
+	return err
+}
+
+// OnUpdate manages the active set of listening sockets according to the
+// given complete list of services.
+func (proxier *Proxier) OnUpdate(services []api.Service) {
+	activeServices := make(map[string]bool)
+	for _, service := range services {
+		activeServices[service.ID] = true
+		var bindAddr net.IP
+		if service.BindAddress != "" {
+			bindAddr = net.ParseIP(service.BindAddress)
+			if bindAddr == nil {
+				glog.Errorf("Service %s has an invalid BindAddress %q, using the default", service.ID, service.BindAddress)
+			}
+		}
+		if err := proxier.addService(service.ID, bindAddr, service.Port, service.Protocol,
+			service.Config.IdleTimeout, service.Config.MaxSessions); err != nil {
+			glog.Errorf("Failed to start proxying %s: %v", service.ID, err)
+		}
+	}
+
+	proxier.mu.Lock()
+	var stale []string
+	for service := range proxier.serviceMap {
+		if !activeServices[service] {
+			stale = append(stale, service)
+		}
+	}
+	proxier.mu.Unlock()
+
+	for _, service := range stale {
+		glog.Infof("Removing service: %s", service)
+		if err := proxier.StopProxy(service); err != nil {
+			glog.Errorf("Failed to stop proxying %s: %v", service, err)
+		}
+	}
+}
+
+// Stats aggregates UDP session counters across all services currently
+// being proxied.
+func (proxier *Proxier) Stats() ProxierStats {
+	proxier.mu.Lock()
+	defer proxier.mu.Unlock()
+
+	var stats ProxierStats
+	for _, info := range proxier.serviceMap {
+		sp, ok := info.socket.(statsProvider)
+		if !ok {
+			continue
+		}
+		active, forwarded, timeouts := sp.snapshotStats()
+		stats.ActiveUDPSessions += active
+		stats.UDPPacketsForwarded += forwarded
+		stats.UDPTimeouts += timeouts
+	}
+	return stats
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+func TestTCPProxyIPv6Loopback(t *testing.T) {
+	lb := NewLoadBalancerRR()
+	lb.OnUpdate([]api.Endpoints{
+		{
+			JSONBase:  api.JSONBase{ID: "echo"},
+			Endpoints: []string{net.JoinHostPort("127.0.0.1", tcpServerPort)},
+		},
+	})
+
+	p := NewProxier(lb, net.ParseIP("::1"))
+
+	proxyPort, err := p.addServiceOnUnusedPort("echo", "TCP", 0)
+	if err != nil {
+		t.Fatalf("error adding new service: %#v", err)
+	}
+	testEchoTCP(t, "::1", proxyPort)
+}
+
+func TestUDPProxyIPv6Loopback(t *testing.T) {
+	lb := NewLoadBalancerRR()
+	lb.OnUpdate([]api.Endpoints{
+		{
+			JSONBase:  api.JSONBase{ID: "echo"},
+			Endpoints: []string{net.JoinHostPort("127.0.0.1", udpServerPort)},
+		},
+	})
+
+	p := NewProxier(lb, net.ParseIP("::1"))
+
+	proxyPort, err := p.addServiceOnUnusedPort("echo", "UDP", time.Second)
+	if err != nil {
+		t.Fatalf("error adding new service: %#v", err)
+	}
+	testEchoUDP(t, "::1", proxyPort)
+}
+
+func TestProxierPerServiceBindAddressOverride(t *testing.T) {
+	lb := NewLoadBalancerRR()
+	lb.OnUpdate([]api.Endpoints{
+		{
+			JSONBase:  api.JSONBase{ID: "echo"},
+			Endpoints: []string{net.JoinHostPort("127.0.0.1", tcpServerPort)},
+		},
+	})
+
+	p := NewProxier(lb, net.ParseIP("0.0.0.0"))
+	p.OnUpdate([]api.Service{
+		{JSONBase: api.JSONBase{ID: "echo"}, Port: 0, Protocol: "TCP", BindAddress: "127.0.0.1"},
+	})
+
+	info, exists := p.getServiceInfo("echo")
+	if !exists {
+		t.Fatalf("expected service info for echo")
+	}
+	if !info.bindAddr.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("expected per-service bind address 127.0.0.1, got %v", info.bindAddr)
+	}
+}
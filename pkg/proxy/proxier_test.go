@@ -144,7 +144,7 @@ func TestTCPProxy(t *testing.T) {
 		},
 	})
 
-	p := NewProxier(lb, "127.0.0.1")
+	p := NewProxier(lb, net.ParseIP("127.0.0.1"))
 
 	proxyPort, err := p.addServiceOnUnusedPort("echo", "TCP", 0)
 	if err != nil {
@@ -162,7 +162,7 @@ func TestUDPProxy(t *testing.T) {
 		},
 	})
 
-	p := NewProxier(lb, "127.0.0.1")
+	p := NewProxier(lb, net.ParseIP("127.0.0.1"))
 
 	proxyPort, err := p.addServiceOnUnusedPort("echo", "UDP", time.Second)
 	if err != nil {
@@ -180,7 +180,7 @@ func TestTCPProxyStop(t *testing.T) {
 		},
 	})
 
-	p := NewProxier(lb, "127.0.0.1")
+	p := NewProxier(lb, net.ParseIP("127.0.0.1"))
 
 	proxyPort, err := p.addServiceOnUnusedPort("echo", "TCP", 0)
 	if err != nil {
@@ -208,7 +208,7 @@ func TestUDPProxyStop(t *testing.T) {
 		},
 	})
 
-	p := NewProxier(lb, "127.0.0.1")
+	p := NewProxier(lb, net.ParseIP("127.0.0.1"))
 
 	proxyPort, err := p.addServiceOnUnusedPort("echo", "UDP", time.Second)
 	if err != nil {
@@ -236,7 +236,7 @@ func TestTCPProxyUpdateDelete(t *testing.T) {
 		},
 	})
 
-	p := NewProxier(lb, "127.0.0.1")
+	p := NewProxier(lb, net.ParseIP("127.0.0.1"))
 
 	proxyPort, err := p.addServiceOnUnusedPort("echo", "TCP", 0)
 	if err != nil {
@@ -263,7 +263,7 @@ func TestUDPProxyUpdateDelete(t *testing.T) {
 		},
 	})
 
-	p := NewProxier(lb, "127.0.0.1")
+	p := NewProxier(lb, net.ParseIP("127.0.0.1"))
 
 	proxyPort, err := p.addServiceOnUnusedPort("echo", "UDP", time.Second)
 	if err != nil {
@@ -290,7 +290,7 @@ func TestTCPProxyUpdateDeleteUpdate(t *testing.T) {
 		},
 	})
 
-	p := NewProxier(lb, "127.0.0.1")
+	p := NewProxier(lb, net.ParseIP("127.0.0.1"))
 
 	proxyPort, err := p.addServiceOnUnusedPort("echo", "TCP", 0)
 	if err != nil {
@@ -322,7 +322,7 @@ func TestUDPProxyUpdateDeleteUpdate(t *testing.T) {
 		},
 	})
 
-	p := NewProxier(lb, "127.0.0.1")
+	p := NewProxier(lb, net.ParseIP("127.0.0.1"))
 
 	proxyPort, err := p.addServiceOnUnusedPort("echo", "UDP", time.Second)
 	if err != nil {
@@ -354,7 +354,7 @@ func TestTCPProxyUpdatePort(t *testing.T) {
 		},
 	})
 
-	p := NewProxier(lb, "127.0.0.1")
+	p := NewProxier(lb, net.ParseIP("127.0.0.1"))
 
 	proxyPort, err := p.addServiceOnUnusedPort("echo", "TCP", 0)
 	if err != nil {
@@ -399,7 +399,7 @@ func TestUDPProxyUpdatePort(t *testing.T) {
 		},
 	})
 
-	p := NewProxier(lb, "127.0.0.1")
+	p := NewProxier(lb, net.ParseIP("127.0.0.1"))
 
 	proxyPort, err := p.addServiceOnUnusedPort("echo", "UDP", time.Second)
 	if err != nil {
@@ -0,0 +1,129 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// proxySocket is an abstraction over a socket that proxies connections or
+// packets to a backend chosen by a LoadBalancer.
+type proxySocket interface {
+	// Addr returns the address on which the proxy is listening.
+	Addr() net.Addr
+	// Close stops the proxy and releases the underlying socket.
+	Close() error
+	// ProxyLoop proxies incoming connections/packets for the named service
+	// to an endpoint chosen by lb, until the socket is closed.
+	ProxyLoop(service string, lb LoadBalancer)
+}
+
+// newProxySocket creates a proxySocket for the given protocol ("tcp" or
+// "udp") listening on bindAddr:port. bindAddr may be nil, in which case the
+// socket listens on all interfaces for both address families; otherwise the
+// network is selected as "<protocol>6" when bindAddr is an IPv6 address, so
+// that the kernel binds a v6-only socket rather than a v4-mapped one.
+// idleTimeout and maxSessions only apply to "udp" sockets; a zero
+// idleTimeout means UDP sessions are never reaped for inactivity, and a
+// zero maxSessions means the session count is unbounded.
+func newProxySocket(protocol string, bindAddr net.IP, port int, idleTimeout time.Duration, maxSessions int) (proxySocket, error) {
+	host := ""
+	network := protocol
+	if bindAddr != nil {
+		host = bindAddr.String()
+		if bindAddr.To4() == nil {
+			network = protocol + "6"
+		}
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	switch protocol {
+	case "tcp":
+		listener, err := net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &tcpProxySocket{Listener: listener}, nil
+	case "udp":
+		udpAddr, err := net.ResolveUDPAddr(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := net.ListenUDP(network, udpAddr)
+		if err != nil {
+			return nil, err
+		}
+		return newUDPProxySocket(conn, idleTimeout, maxSessions), nil
+	}
+	return nil, fmt.Errorf("unknown protocol %q", protocol)
+}
+
+type tcpProxySocket struct {
+	net.Listener
+}
+
+func (tcp *tcpProxySocket) ProxyLoop(service string, lb LoadBalancer) {
+	for {
+		inConn, err := tcp.Accept()
+		if err != nil {
+			// The listener has been closed; stop looping.
+			return
+		}
+		endpoint, err := lb.NextEndpoint(service, inConn.RemoteAddr())
+		if err != nil {
+			glog.Errorf("Couldn't find an endpoint for %s: %v", service, err)
+			inConn.Close()
+			continue
+		}
+		outConn, err := net.Dial("tcp", endpoint)
+		if err != nil {
+			glog.Errorf("Error connecting to %s: %v", endpoint, err)
+			inConn.Close()
+			continue
+		}
+		if tracker, ok := lb.(ConnectionTracker); ok {
+			tracker.Connected(service, endpoint)
+		}
+		go proxyTCP(service, endpoint, lb, inConn.(*net.TCPConn), outConn.(*net.TCPConn))
+	}
+}
+
+func proxyTCP(service, endpoint string, lb LoadBalancer, in, out *net.TCPConn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go copyBytes(in, out, &wg)
+	go copyBytes(out, in, &wg)
+	wg.Wait()
+	in.Close()
+	out.Close()
+	if tracker, ok := lb.(ConnectionTracker); ok {
+		tracker.Disconnected(service, endpoint)
+	}
+}
+
+func copyBytes(in, out *net.TCPConn, wg *sync.WaitGroup) {
+	defer wg.Done()
+	io.Copy(out, in)
+	out.CloseWrite()
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// defaultHealthCheckInterval is how often LoadBalancerRR probes each
+// endpoint it's tracking, absent a call to SetHealthCheckInterval.
+const defaultHealthCheckInterval = 2 * time.Second
+
+// LoadBalancerRR is a round-robin LoadBalancer. Endpoints are actively
+// health-checked in the background; NextEndpoint skips any endpoint whose
+// most recent probe failed, and picks it back up once a probe succeeds
+// again.
+type LoadBalancerRR struct {
+	lock      sync.RWMutex
+	endpoints map[string][]string
+	next      map[string]int
+	healthy   map[string]map[string]bool          // service -> endpoint -> last probe result
+	stopProbe map[string]map[string]chan struct{} // service -> endpoint -> probe cancel
+	interval  time.Duration
+}
+
+// NewLoadBalancerRR returns a new LoadBalancerRR.
+func NewLoadBalancerRR() *LoadBalancerRR {
+	return &LoadBalancerRR{
+		endpoints: map[string][]string{},
+		next:      map[string]int{},
+		healthy:   map[string]map[string]bool{},
+		stopProbe: map[string]map[string]chan struct{}{},
+		interval:  defaultHealthCheckInterval,
+	}
+}
+
+// SetHealthCheckInterval overrides the probe interval used for endpoints
+// registered by subsequent calls to OnUpdate.
+func (lb *LoadBalancerRR) SetHealthCheckInterval(interval time.Duration) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	lb.interval = interval
+}
+
+func (lb *LoadBalancerRR) NextEndpoint(service string, srcAddr net.Addr) (string, error) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	endpoints := lb.endpoints[service]
+	if len(endpoints) == 0 {
+		return "", fmt.Errorf("no endpoints for %s", service)
+	}
+
+	healthy := lb.healthy[service]
+	for attempt := 0; attempt < len(endpoints); attempt++ {
+		index := lb.next[service]
+		endpoint := endpoints[index]
+		lb.next[service] = (index + 1) % len(endpoints)
+		if healthy == nil || healthy[endpoint] {
+			return endpoint, nil
+		}
+	}
+	return "", fmt.Errorf("no healthy endpoints for %s", service)
+}
+
+func (lb *LoadBalancerRR) ListEndpoints(service string) []string {
+	lb.lock.RLock()
+	defer lb.lock.RUnlock()
+	return append([]string{}, lb.endpoints[service]...)
+}
+
+func (lb *LoadBalancerRR) OnUpdate(endpoints []api.Endpoints) {
+	registeredEndpoints := make(map[string]bool)
+
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	for _, svcEndpoints := range endpoints {
+		service := svcEndpoints.ID
+		registeredEndpoints[service] = true
+
+		oldSet := map[string]bool{}
+		for _, endpoint := range lb.endpoints[service] {
+			oldSet[endpoint] = true
+		}
+		newSet := map[string]bool{}
+		for _, endpoint := range svcEndpoints.Endpoints {
+			newSet[endpoint] = true
+		}
+
+		lb.endpoints[service] = svcEndpoints.Endpoints
+		// Reset the cursor on every update, even an unchanged one, so a
+		// stale index left over from a larger set can't run past the new
+		// slice.
+		lb.next[service] = 0
+		if lb.healthy[service] == nil {
+			lb.healthy[service] = map[string]bool{}
+		}
+		if lb.stopProbe[service] == nil {
+			lb.stopProbe[service] = map[string]chan struct{}{}
+		}
+
+		for endpoint := range oldSet {
+			if !newSet[endpoint] {
+				lb.cancelProbe(service, endpoint)
+				delete(lb.healthy[service], endpoint)
+			}
+		}
+
+		checker := healthCheckerFor(svcEndpoints, lb.probeTimeout())
+		for endpoint := range newSet {
+			if !oldSet[endpoint] {
+				// Assume healthy until the first probe says otherwise, so a
+				// brand new endpoint isn't skipped before it's even checked.
+				lb.healthy[service][endpoint] = true
+				stop := make(chan struct{})
+				lb.stopProbe[service][endpoint] = stop
+				go lb.probeLoop(service, endpoint, checker, lb.interval, stop)
+			}
+		}
+	}
+
+	for service := range lb.endpoints {
+		if !registeredEndpoints[service] {
+			for endpoint := range lb.stopProbe[service] {
+				lb.cancelProbe(service, endpoint)
+			}
+			delete(lb.endpoints, service)
+			delete(lb.next, service)
+			delete(lb.healthy, service)
+			delete(lb.stopProbe, service)
+		}
+	}
+}
+
+// cancelProbe stops the probe goroutine for service/endpoint, if any.
+// Callers must hold lb.lock.
+func (lb *LoadBalancerRR) cancelProbe(service, endpoint string) {
+	stop, exists := lb.stopProbe[service][endpoint]
+	if !exists {
+		return
+	}
+	close(stop)
+	delete(lb.stopProbe[service], endpoint)
+}
+
+// probeTimeout derives a per-probe timeout from the configured interval so
+// a slow probe can't pile up past the next tick.
+func (lb *LoadBalancerRR) probeTimeout() time.Duration {
+	timeout := lb.interval / 2
+	if timeout < 100*time.Millisecond {
+		timeout = 100 * time.Millisecond
+	}
+	return timeout
+}
+
+func (lb *LoadBalancerRR) probeLoop(service, endpoint string, checker HealthChecker, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			healthy := checker.IsHealthy(endpoint)
+			lb.lock.Lock()
+			if m, exists := lb.healthy[service]; exists {
+				m[endpoint] = healthy
+			}
+			lb.lock.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
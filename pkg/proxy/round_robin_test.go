@@ -0,0 +1,119 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+func TestLoadBalancerRRFailsOverUnhealthyEndpoint(t *testing.T) {
+	good, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer good.Close()
+
+	bad, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	badAddr := bad.Addr().String()
+	bad.Close() // "kill" the backend before it's ever dialed successfully
+
+	lb := NewLoadBalancerRR()
+	lb.SetHealthCheckInterval(10 * time.Millisecond)
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{good.Addr().String(), badAddr}},
+	})
+
+	deadline := time.Now().Add(1 * time.Second)
+	for time.Now().Before(deadline) {
+		// Until a failed probe marks the dead backend, one call in every
+		// full cycle over both endpoints still lands on it.
+		sawBad := false
+		for i := 0; i < 2; i++ {
+			endpoint, err := lb.NextEndpoint("echo", nil)
+			if err != nil {
+				t.Fatalf("unexpected error from NextEndpoint: %v", err)
+			}
+			if endpoint == badAddr {
+				sawBad = true
+			}
+		}
+		if sawBad {
+			time.Sleep(5 * time.Millisecond)
+			continue
+		}
+		// Got the healthy endpoint on every call for a full cycle, so the
+		// dead one is being skipped; it must stay that way.
+		for i := 0; i < 10; i++ {
+			endpoint, err := lb.NextEndpoint("echo", nil)
+			if err != nil {
+				t.Fatalf("unexpected error from NextEndpoint: %v", err)
+			}
+			if endpoint != good.Addr().String() {
+				t.Fatalf("expected to only be routed to the healthy endpoint, got %s", endpoint)
+			}
+		}
+		return
+	}
+	t.Fatalf("endpoint never failed over away from %s within the deadline", badAddr)
+}
+
+func TestLoadBalancerRRHandlesShrinkingEndpoints(t *testing.T) {
+	lb := NewLoadBalancerRR()
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{"1.1.1.1:1", "2.2.2.2:2", "3.3.3.3:3"}},
+	})
+
+	// Advance the cursor past what the shrunk endpoint set will hold.
+	for i := 0; i < 3; i++ {
+		if _, err := lb.NextEndpoint("echo", nil); err != nil {
+			t.Fatalf("unexpected error from NextEndpoint: %v", err)
+		}
+	}
+
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{"1.1.1.1:1", "2.2.2.2:2"}},
+	})
+
+	if _, err := lb.NextEndpoint("echo", nil); err != nil {
+		t.Fatalf("unexpected error from NextEndpoint after endpoints shrank: %v", err)
+	}
+}
+
+func TestLoadBalancerRRCancelsProbesOnRemoval(t *testing.T) {
+	lb := NewLoadBalancerRR()
+	lb.SetHealthCheckInterval(5 * time.Millisecond)
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{"127.0.0.1:1"}},
+	})
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{}},
+	})
+
+	lb.lock.RLock()
+	_, stillRunning := lb.stopProbe["echo"]["127.0.0.1:1"]
+	lb.lock.RUnlock()
+	if stillRunning {
+		t.Errorf("expected the probe for a removed endpoint to be cancelled")
+	}
+}
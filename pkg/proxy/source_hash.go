@@ -0,0 +1,130 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"hash/crc32"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// virtualNodesPerEndpoint is the number of points each endpoint gets on the
+// consistent hash ring. A higher count spreads clients more evenly across
+// endpoints at the cost of a larger ring to search.
+const virtualNodesPerEndpoint = 160
+
+// SourceHashLoadBalancer is a LoadBalancer that consistently maps a client
+// IP to the same endpoint, using an ring built with crc32. This gives UDP
+// services session affinity without any client-visible state, and endpoint
+// churn only remaps the clients whose hash falls between an added or
+// removed endpoint's virtual node and the ring point just before it.
+type SourceHashLoadBalancer struct {
+	lock  sync.RWMutex
+	rings map[string]*hashRing
+}
+
+type hashRing struct {
+	points    []uint32
+	endpoints map[uint32]string
+}
+
+// NewSourceHashLoadBalancer returns a new SourceHashLoadBalancer.
+func NewSourceHashLoadBalancer() *SourceHashLoadBalancer {
+	return &SourceHashLoadBalancer{
+		rings: map[string]*hashRing{},
+	}
+}
+
+func (lb *SourceHashLoadBalancer) NextEndpoint(service string, srcAddr net.Addr) (string, error) {
+	lb.lock.RLock()
+	defer lb.lock.RUnlock()
+
+	ring, exists := lb.rings[service]
+	if !exists || len(ring.points) == 0 {
+		return "", fmt.Errorf("no endpoints for %s", service)
+	}
+
+	key := crc32.ChecksumIEEE([]byte(clientIP(srcAddr)))
+	i := sort.Search(len(ring.points), func(i int) bool { return ring.points[i] >= key })
+	if i == len(ring.points) {
+		i = 0
+	}
+	return ring.endpoints[ring.points[i]], nil
+}
+
+// clientIP extracts the host portion of a net.Addr, ignoring the port so
+// that all connections from one client hash to the same value.
+func clientIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+func (lb *SourceHashLoadBalancer) ListEndpoints(service string) []string {
+	lb.lock.RLock()
+	defer lb.lock.RUnlock()
+	ring, exists := lb.rings[service]
+	if !exists {
+		return nil
+	}
+	seen := map[string]bool{}
+	var endpoints []string
+	for _, point := range ring.points {
+		endpoint := ring.endpoints[point]
+		if !seen[endpoint] {
+			seen[endpoint] = true
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+func (lb *SourceHashLoadBalancer) OnUpdate(endpoints []api.Endpoints) {
+	rings := map[string]*hashRing{}
+	for _, svcEndpoints := range endpoints {
+		rings[svcEndpoints.ID] = newHashRing(svcEndpoints.Endpoints)
+	}
+
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	lb.rings = rings
+}
+
+func newHashRing(endpoints []string) *hashRing {
+	ring := &hashRing{endpoints: map[uint32]string{}}
+	for _, endpoint := range endpoints {
+		for i := 0; i < virtualNodesPerEndpoint; i++ {
+			point := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s-%d", endpoint, i)))
+			ring.endpoints[point] = endpoint
+			ring.points = append(ring.points, point)
+		}
+	}
+	sort.Sort(uint32Slice(ring.points))
+	return ring
+}
+
+type uint32Slice []uint32
+
+func (s uint32Slice) Len() int           { return len(s) }
+func (s uint32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
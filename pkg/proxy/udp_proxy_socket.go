@@ -0,0 +1,237 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// sweepInterval is how often udpProxySocket checks for idle sessions. It is
+// independent of idleTimeout so a short timeout is still enforced promptly.
+const sweepInterval = 1 * time.Second
+
+// clock lets tests substitute a fake notion of "now" so idle-timeout
+// behavior doesn't depend on wall-clock sleeps.
+type clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// udpSession is one client's in-progress conversation with a backend. UDP
+// has no handshake or close, so "session" here just means "we've seen
+// traffic from this client recently and are reusing its backend socket."
+type udpSession struct {
+	clientAddr net.Addr
+	backend    *net.UDPConn
+	lastActive int64 // unix nanos, updated atomically
+}
+
+// udpProxySocket is a proxySocket that tracks one backend connection per
+// client address, reaping connections that have been idle for longer than
+// idleTimeout.
+type udpProxySocket struct {
+	*net.UDPConn
+
+	idleTimeout time.Duration
+	maxSessions int
+	clock       clock
+
+	mu       sync.Mutex
+	sessions map[string]*udpSession
+
+	stopSweep chan struct{}
+
+	packetsForwarded int64
+	timeouts         int64
+}
+
+func newUDPProxySocket(conn *net.UDPConn, idleTimeout time.Duration, maxSessions int) *udpProxySocket {
+	udp := &udpProxySocket{
+		UDPConn:     conn,
+		idleTimeout: idleTimeout,
+		maxSessions: maxSessions,
+		clock:       realClock{},
+		sessions:    map[string]*udpSession{},
+		stopSweep:   make(chan struct{}),
+	}
+	if idleTimeout > 0 {
+		go udp.sweepLoop()
+	}
+	return udp
+}
+
+func (udp *udpProxySocket) Addr() net.Addr {
+	return udp.LocalAddr()
+}
+
+func (udp *udpProxySocket) Close() error {
+	close(udp.stopSweep)
+	udp.mu.Lock()
+	for key, session := range udp.sessions {
+		session.backend.Close()
+		delete(udp.sessions, key)
+	}
+	udp.mu.Unlock()
+	return udp.UDPConn.Close()
+}
+
+func (udp *udpProxySocket) ProxyLoop(service string, lb LoadBalancer) {
+	var buffer [4096]byte
+	for {
+		n, cliAddr, err := udp.ReadFrom(buffer[0:])
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Temporary() {
+				continue
+			}
+			return
+		}
+
+		session, err := udp.getSession(service, cliAddr, lb)
+		if err != nil {
+			glog.Errorf("Couldn't find an endpoint for %s: %v", service, err)
+			continue
+		}
+
+		if _, err := session.backend.Write(buffer[0:n]); err != nil {
+			glog.Errorf("Error writing to %v for %s: %v", session.backend.RemoteAddr(), service, err)
+			udp.closeSession(cliAddr.String())
+			continue
+		}
+		atomic.StoreInt64(&session.lastActive, udp.clock.Now().UnixNano())
+		atomic.AddInt64(&udp.packetsForwarded, 1)
+	}
+}
+
+func (udp *udpProxySocket) getSession(service string, cliAddr net.Addr, lb LoadBalancer) (*udpSession, error) {
+	key := cliAddr.String()
+
+	udp.mu.Lock()
+	session, exists := udp.sessions[key]
+	udp.mu.Unlock()
+	if exists {
+		return session, nil
+	}
+
+	endpoint, err := lb.NextEndpoint(service, cliAddr)
+	if err != nil {
+		return nil, err
+	}
+	endpointAddr, err := net.ResolveUDPAddr("udp", endpoint)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := net.DialUDP("udp", nil, endpointAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	udp.mu.Lock()
+	if udp.maxSessions > 0 && len(udp.sessions) >= udp.maxSessions {
+		udp.mu.Unlock()
+		backend.Close()
+		return nil, fmt.Errorf("too many active UDP sessions for %s", service)
+	}
+	session = &udpSession{clientAddr: cliAddr, backend: backend}
+	atomic.StoreInt64(&session.lastActive, udp.clock.Now().UnixNano())
+	udp.sessions[key] = session
+	udp.mu.Unlock()
+
+	go udp.readBackend(service, key, session)
+	return session, nil
+}
+
+// readBackend copies responses from a session's backend connection back to
+// the original client for as long as the session stays open.
+func (udp *udpProxySocket) readBackend(service, key string, session *udpSession) {
+	var buffer [4096]byte
+	for {
+		n, err := session.backend.Read(buffer[0:])
+		if err != nil {
+			return
+		}
+		if _, err := udp.WriteTo(buffer[0:n], session.clientAddr); err != nil {
+			glog.Errorf("Error writing to client %v for %s: %v", session.clientAddr, service, err)
+			return
+		}
+		atomic.StoreInt64(&session.lastActive, udp.clock.Now().UnixNano())
+		atomic.AddInt64(&udp.packetsForwarded, 1)
+	}
+}
+
+func (udp *udpProxySocket) closeSession(key string) {
+	udp.mu.Lock()
+	session, exists := udp.sessions[key]
+	if exists {
+		delete(udp.sessions, key)
+	}
+	udp.mu.Unlock()
+	if exists {
+		session.backend.Close()
+	}
+}
+
+func (udp *udpProxySocket) sweepLoop() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			udp.sweep()
+		case <-udp.stopSweep:
+			return
+		}
+	}
+}
+
+func (udp *udpProxySocket) sweep() {
+	now := udp.clock.Now()
+	var stale []string
+
+	udp.mu.Lock()
+	for key, session := range udp.sessions {
+		lastActive := time.Unix(0, atomic.LoadInt64(&session.lastActive))
+		if now.Sub(lastActive) > udp.idleTimeout {
+			stale = append(stale, key)
+		}
+	}
+	for _, key := range stale {
+		udp.sessions[key].backend.Close()
+		delete(udp.sessions, key)
+	}
+	udp.mu.Unlock()
+
+	if len(stale) > 0 {
+		atomic.AddInt64(&udp.timeouts, int64(len(stale)))
+	}
+}
+
+// snapshotStats implements statsProvider.
+func (udp *udpProxySocket) snapshotStats() (active, forwarded, timeouts int64) {
+	udp.mu.Lock()
+	active = int64(len(udp.sessions))
+	udp.mu.Unlock()
+	return active, atomic.LoadInt64(&udp.packetsForwarded), atomic.LoadInt64(&udp.timeouts)
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// fakeClock is a manually-advanced clock, so idle-timeout tests don't need
+// to sleep past a real timeout.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestUDPProxySessionIdleTimeout(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+
+	fc := &fakeClock{now: time.Unix(0, 0)}
+	udp := &udpProxySocket{
+		UDPConn:     conn,
+		idleTimeout: time.Second,
+		clock:       fc,
+		sessions:    map[string]*udpSession{},
+		stopSweep:   make(chan struct{}),
+	}
+	defer udp.UDPConn.Close()
+
+	lb := NewLoadBalancerRR()
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{net.JoinHostPort("127.0.0.1", udpServerPort)}},
+	})
+	go udp.ProxyLoop("echo", lb)
+
+	_, proxyPort, err := net.SplitHostPort(udp.Addr().String())
+	if err != nil {
+		t.Fatalf("error splitting address: %v", err)
+	}
+	testEchoUDP(t, "127.0.0.1", proxyPort)
+
+	if err := waitForCondition(func() bool { return udp.snapshotActiveSessions() == 1 }); err != nil {
+		t.Fatalf("session was never created: %v", err)
+	}
+
+	fc.Advance(2 * time.Second)
+	udp.sweep()
+
+	active, _, timeouts := udp.snapshotStats()
+	if active != 0 {
+		t.Errorf("expected the idle session to be evicted, got %d active", active)
+	}
+	if timeouts != 1 {
+		t.Errorf("expected 1 recorded timeout, got %d", timeouts)
+	}
+}
+
+func TestProxierStats(t *testing.T) {
+	lb := NewLoadBalancerRR()
+	lb.OnUpdate([]api.Endpoints{
+		{JSONBase: api.JSONBase{ID: "echo"}, Endpoints: []string{net.JoinHostPort("127.0.0.1", udpServerPort)}},
+	})
+
+	p := NewProxier(lb, net.ParseIP("127.0.0.1"))
+	proxyPort, err := p.addServiceOnUnusedPort("echo", "UDP", time.Second)
+	if err != nil {
+		t.Fatalf("error adding new service: %#v", err)
+	}
+	testEchoUDP(t, "127.0.0.1", proxyPort)
+
+	if err := waitForCondition(func() bool { return p.Stats().UDPPacketsForwarded > 0 }); err != nil {
+		t.Fatalf("expected forwarded packets to be counted: %v", err)
+	}
+	if active := p.Stats().ActiveUDPSessions; active != 1 {
+		t.Errorf("expected 1 active UDP session, got %d", active)
+	}
+}
+
+func (udp *udpProxySocket) snapshotActiveSessions() int {
+	udp.mu.Lock()
+	defer udp.mu.Unlock()
+	return len(udp.sessions)
+}
+
+func waitForCondition(cond func() bool) error {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return nil
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	return fmt.Errorf("condition never became true")
+}
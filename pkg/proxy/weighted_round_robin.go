@@ -0,0 +1,116 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// WeightedRoundRobinLoadBalancer is a LoadBalancer that distributes
+// connections across endpoints in proportion to per-endpoint weights,
+// supplied via api.Endpoints.Weights (keyed by "host:port"). An endpoint
+// with no entry in Weights defaults to weight 1.
+type WeightedRoundRobinLoadBalancer struct {
+	lock     sync.Mutex
+	schedule map[string][]string // service -> endpoints, each repeated per its weight
+	next     map[string]int
+}
+
+// NewWeightedRoundRobinLoadBalancer returns a new
+// WeightedRoundRobinLoadBalancer.
+func NewWeightedRoundRobinLoadBalancer() *WeightedRoundRobinLoadBalancer {
+	return &WeightedRoundRobinLoadBalancer{
+		schedule: map[string][]string{},
+		next:     map[string]int{},
+	}
+}
+
+func (lb *WeightedRoundRobinLoadBalancer) NextEndpoint(service string, srcAddr net.Addr) (string, error) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	schedule := lb.schedule[service]
+	if len(schedule) == 0 {
+		return "", fmt.Errorf("no endpoints for %s", service)
+	}
+
+	index := lb.next[service]
+	endpoint := schedule[index]
+	lb.next[service] = (index + 1) % len(schedule)
+	return endpoint, nil
+}
+
+func (lb *WeightedRoundRobinLoadBalancer) ListEndpoints(service string) []string {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	seen := map[string]bool{}
+	var endpoints []string
+	for _, endpoint := range lb.schedule[service] {
+		if !seen[endpoint] {
+			seen[endpoint] = true
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+func (lb *WeightedRoundRobinLoadBalancer) OnUpdate(endpoints []api.Endpoints) {
+	schedule := map[string][]string{}
+	for _, svcEndpoints := range endpoints {
+		schedule[svcEndpoints.ID] = weightedSchedule(svcEndpoints.Endpoints, svcEndpoints.Weights)
+	}
+
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	lb.schedule = schedule
+	// The schedule was just rebuilt and may be shorter than before, so any
+	// cursor left over from the old schedule could run past its end.
+	lb.next = map[string]int{}
+}
+
+// weightedSchedule interleaves endpoints so that, over one full pass, each
+// endpoint appears in proportion to its weight. Interleaving (rather than
+// grouping all copies of one endpoint together) avoids bursting every
+// connection to the heaviest endpoint at the start of each cycle.
+func weightedSchedule(endpoints []string, weights map[string]int) []string {
+	remaining := make([]int, len(endpoints))
+	total := 0
+	for i, endpoint := range endpoints {
+		weight := weights[endpoint]
+		if weight <= 0 {
+			weight = 1
+		}
+		remaining[i] = weight
+		total += weight
+	}
+
+	schedule := make([]string, 0, total)
+	for len(schedule) < total {
+		for i, endpoint := range endpoints {
+			if remaining[i] > 0 {
+				schedule = append(schedule, endpoint)
+				remaining[i]--
+			}
+		}
+	}
+	return schedule
+}